@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const explainSystemPrompt = `You are a terminal assistant embedded in a command-line tool. Given a shell command, explain: (1) what the command does as a whole, (2) each flag and argument in turn, and (3) 2-3 realistic usage examples with their expected output. Be precise, favor concrete examples over abstract description, and tailor examples to the user's shell when told which one they use.`
+
+// explainMaxTokens is the default token budget for `perp explain`. A full
+// explanation with a flag-by-flag breakdown and several worked examples
+// runs much longer than the one-line answers the default query path is
+// tuned for, so this is sized well above that 123-token default.
+const explainMaxTokens = 1024
+
+// runExplainCommand implements `perp explain <shell command>`.
+func runExplainCommand(args []string) {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	model := fs.String("model", "sonar", "Model name to use (defaults to sonar)")
+	provider := fs.String("provider", "", "Completer to use: perplexity, openai, anthropic, or mistral (defaults to $DEFAULT_COMPLETER or perplexity)")
+	shellName := fs.String("shell", "", "Shell to tailor examples for: bash, zsh, or fish (defaults to $SHELL)")
+	maxTokens := fs.Int("max-tokens", explainMaxTokens, "Token budget for the explanation")
+	dryRun := fs.Bool("dry-run", false, "Print the assembled prompt instead of sending it")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 {
+		fmt.Println("Usage: perp explain [--shell bash|zsh|fish] [--max-tokens N] [--dry-run] <shell command>")
+		os.Exit(1)
+	}
+	command := strings.Join(fs.Args(), " ")
+
+	shell := *shellName
+	if shell == "" {
+		shell = detectShell()
+	}
+
+	query := fmt.Sprintf("The user's shell is %s. Explain this command:\n\n%s", shell, command)
+
+	if *dryRun {
+		fmt.Println(explainSystemPrompt)
+		fmt.Println()
+		fmt.Println(query)
+		return
+	}
+
+	completer, err := NewCompleter(*provider)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	payload := RequestPayload{
+		Model:       *model,
+		MaxTokens:   *maxTokens,
+		Temperature: 0.2,
+		TopP:        0.9,
+		Stream:      true,
+		Messages: []Message{
+			{Role: "system", Content: explainSystemPrompt},
+			{Role: "user", Content: query},
+		},
+	}
+
+	events, err := completer.Stream(context.Background(), payload)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for event := range events {
+		fmt.Print(event.Content)
+	}
+	fmt.Println()
+}
+
+// detectShell returns the basename of $SHELL, or "bash" if it isn't set.
+func detectShell() string {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		return "bash"
+	}
+	return filepath.Base(shell)
+}
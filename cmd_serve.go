@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// openAIChatRequest is the subset of the OpenAI chat completions request
+// body this proxy understands.
+type openAIChatRequest struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream"`
+}
+
+// openAIChunk is one Server-Sent Event in the OpenAI streaming response
+// format.
+type openAIChunk struct {
+	ID      string              `json:"id"`
+	Object  string              `json:"object"`
+	Created int64               `json:"created"`
+	Model   string              `json:"model"`
+	Choices []openAIChunkChoice `json:"choices"`
+}
+
+type openAIChunkChoice struct {
+	Index        int     `json:"index"`
+	Delta        Message `json:"delta"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+// openAIChatResponse is a non-streaming OpenAI chat completions response,
+// returned when the request sets "stream": false (the default most OpenAI
+// SDKs use).
+type openAIChatResponse struct {
+	ID      string             `json:"id"`
+	Object  string             `json:"object"`
+	Created int64              `json:"created"`
+	Model   string             `json:"model"`
+	Choices []openAIChatChoice `json:"choices"`
+}
+
+type openAIChatChoice struct {
+	Index        int     `json:"index"`
+	Message      Message `json:"message"`
+	FinishReason string  `json:"finish_reason"`
+}
+
+// runServeCommand implements `perp serve --addr <addr>`, a local reverse
+// proxy that speaks the OpenAI chat completions API on top of Perplexity.
+func runServeCommand(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "Address to listen on")
+	fs.Parse(args)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", handleChatCompletions)
+
+	fmt.Printf("perp serve: listening on %s (POST /v1/chat/completions)\n", *addr)
+	if err := http.ListenAndServe(*addr, mux); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req openAIChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("decoding request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	completer := &perplexityCompleter{}
+	payload := RequestPayload{
+		Model:       req.Model,
+		Messages:    req.Messages,
+		MaxTokens:   123,
+		Temperature: 0.2,
+		TopP:        0.9,
+		Stream:      true,
+	}
+	events, err := completer.Stream(r.Context(), payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	id := fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	created := time.Now().Unix()
+
+	if !req.Stream {
+		var text strings.Builder
+		var citations []string
+		for event := range events {
+			if len(event.Citations) > 0 && len(citations) == 0 {
+				citations = event.Citations
+			}
+			text.WriteString(event.Content)
+		}
+		text.WriteString(citationsText(citations))
+
+		resp := openAIChatResponse{
+			ID:      id,
+			Object:  "chat.completion",
+			Created: created,
+			Model:   req.Model,
+			Choices: []openAIChatChoice{
+				{Message: Message{Role: "assistant", Content: text.String()}, FinishReason: "stop"},
+			},
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var citations []string
+	for event := range events {
+		if len(event.Citations) > 0 && len(citations) == 0 {
+			citations = event.Citations
+		}
+		if event.Content == "" {
+			continue
+		}
+		writeChunk(w, id, created, req.Model, event.Content)
+		flusher.Flush()
+	}
+
+	// Append citations as a trailing chunk, inlined into the assistant
+	// message like a normal piece of content.
+	if text := citationsText(citations); text != "" {
+		writeChunk(w, id, created, req.Model, text)
+		flusher.Flush()
+	}
+
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+// citationsText renders citations the same way for both the streaming and
+// non-streaming response paths, inlined into the assistant message like a
+// normal piece of content. It returns "" when there are no citations.
+func citationsText(citations []string) string {
+	if len(citations) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\n\nCitations:\n")
+	for i, citation := range citations {
+		fmt.Fprintf(&b, "[%d] %s\n", i+1, citation)
+	}
+	return b.String()
+}
+
+func writeChunk(w http.ResponseWriter, id string, created int64, model, content string) {
+	chunk := openAIChunk{
+		ID:      id,
+		Object:  "chat.completion.chunk",
+		Created: created,
+		Model:   model,
+		Choices: []openAIChunkChoice{
+			{Index: 0, Delta: Message{Content: content}},
+		},
+	}
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "data: %s\n\n", data)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/lucas-Nicolas/perp_tool/session"
+)
+
+// runSessionCommand implements `perp session new|list|use|rm`.
+func runSessionCommand(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: perp session new|list|use|rm [name] [--system <prompt>]")
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "new":
+		fs := flag.NewFlagSet("session new", flag.ExitOnError)
+		system := fs.String("system", "", "System prompt for this session")
+		fs.Parse(args[1:])
+		if fs.NArg() < 1 {
+			fmt.Println("Usage: perp session new <name> [--system <prompt>]")
+			os.Exit(1)
+		}
+		if _, err := session.New(fs.Arg(0), *system); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Created session %q\n", fs.Arg(0))
+
+	case "list":
+		names, err := session.List()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if len(names) == 0 {
+			fmt.Println("No sessions yet. Create one with `perp session new <name>`.")
+			return
+		}
+		current, _ := session.Current()
+		for _, name := range names {
+			if name == current {
+				fmt.Printf("* %s\n", name)
+			} else {
+				fmt.Printf("  %s\n", name)
+			}
+		}
+
+	case "use":
+		if len(args) < 2 {
+			fmt.Println("Usage: perp session use <name>")
+			os.Exit(1)
+		}
+		if _, err := session.Load(args[1]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := session.SetCurrent(args[1]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Now using session %q\n", args[1])
+
+	case "rm":
+		if len(args) < 2 {
+			fmt.Println("Usage: perp session rm <name>")
+			os.Exit(1)
+		}
+		if err := session.Remove(args[1]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Removed session %q\n", args[1])
+
+	default:
+		fmt.Printf("Unknown session subcommand %q (want new, list, use, or rm)\n", args[0])
+		os.Exit(1)
+	}
+}
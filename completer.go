@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/lucas-Nicolas/perp_tool/render"
+)
+
+// Event is a single piece of a streamed completion, emitted incrementally as
+// a Completer reads its provider's response.
+type Event struct {
+	Content   string
+	Citations []string
+	Usage     *render.Usage
+}
+
+// Completer streams a chat completion from a single provider.
+type Completer interface {
+	// Stream sends req and returns a channel of Events. The channel is
+	// closed once the stream ends or an error occurs.
+	Stream(ctx context.Context, req RequestPayload) (<-chan Event, error)
+}
+
+// NewCompleter returns the Completer for the named provider. An empty name
+// falls back to the DEFAULT_COMPLETER environment variable, then to
+// "perplexity".
+func NewCompleter(name string) (Completer, error) {
+	if name == "" {
+		name = os.Getenv("DEFAULT_COMPLETER")
+	}
+	if name == "" {
+		name = "perplexity"
+	}
+	switch strings.ToLower(name) {
+	case "perplexity":
+		return &perplexityCompleter{}, nil
+	case "openai":
+		return &openAICompleter{}, nil
+	case "anthropic":
+		return &anthropicCompleter{}, nil
+	case "mistral":
+		return &mistralCompleter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown provider %q (want perplexity, openai, anthropic, or mistral)", name)
+	}
+}
+
+// streamLines reads Server-Sent Events ("data: ..." lines) from body and
+// emits the Event each decode call returns. It stops at the first "[DONE]"
+// marker or when body is exhausted.
+func streamLines(body io.Reader, decode func(data string) (Event, bool)) <-chan Event {
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		reader := bufio.NewReader(body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				if err != io.EOF {
+					events <- Event{Content: fmt.Sprintf("\nError reading stream: %v\n", err)}
+				}
+				return
+			}
+			line = strings.TrimSpace(line)
+			if line == "" || !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			if data == "[DONE]" {
+				return
+			}
+			if event, ok := decode(data); ok {
+				events <- event
+			}
+		}
+	}()
+	return events
+}
+
+// doRequest issues req and returns its body, checking for a non-2xx status
+// first so callers never have to stream an error page.
+func doRequest(req *http.Request) (io.ReadCloser, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sending request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("received status %d\n%s", resp.StatusCode, string(body))
+	}
+	return resp.Body, nil
+}
+
+// perplexityCompleter talks to the Perplexity chat completions API.
+type perplexityCompleter struct{}
+
+func (c *perplexityCompleter) Stream(ctx context.Context, payload RequestPayload) (<-chan Event, error) {
+	apiKey := os.Getenv("PERPLEXITY_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("please set your PERPLEXITY_API_KEY environment variable")
+	}
+
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.perplexity.ai/chat/completions", bytes.NewReader(jsonPayload))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Add("Authorization", "Bearer "+apiKey)
+	req.Header.Add("Content-Type", "application/json")
+
+	body, err := doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return streamLines(body, func(data string) (Event, bool) {
+		var streamResp StreamingResponse
+		if err := json.Unmarshal([]byte(data), &streamResp); err != nil {
+			return Event{}, false
+		}
+		event := Event{Citations: streamResp.Citations, Usage: streamResp.Usage}
+		for _, choice := range streamResp.Choices {
+			content := choice.Delta.Content
+			if content == "" {
+				content = choice.Message.Content
+			}
+			event.Content += content
+		}
+		return event, true
+	}), nil
+}
+
+// openAICompleter talks to the OpenAI chat completions API, which shares its
+// request and streaming-chunk shape with RequestPayload/StreamingResponse.
+type openAICompleter struct{}
+
+func (c *openAICompleter) Stream(ctx context.Context, payload RequestPayload) (<-chan Event, error) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("please set your OPENAI_API_KEY environment variable")
+	}
+
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/chat/completions", bytes.NewReader(jsonPayload))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Add("Authorization", "Bearer "+apiKey)
+	req.Header.Add("Content-Type", "application/json")
+
+	body, err := doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return streamLines(body, func(data string) (Event, bool) {
+		var streamResp StreamingResponse
+		if err := json.Unmarshal([]byte(data), &streamResp); err != nil {
+			return Event{}, false
+		}
+		event := Event{Usage: streamResp.Usage}
+		for _, choice := range streamResp.Choices {
+			event.Content += choice.Delta.Content
+		}
+		return event, true
+	}), nil
+}
+
+// mistralCompleter talks to the Mistral chat completions API, which is
+// OpenAI-compatible.
+type mistralCompleter struct{}
+
+func (c *mistralCompleter) Stream(ctx context.Context, payload RequestPayload) (<-chan Event, error) {
+	apiKey := os.Getenv("MISTRAL_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("please set your MISTRAL_API_KEY environment variable")
+	}
+
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.mistral.ai/v1/chat/completions", bytes.NewReader(jsonPayload))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Add("Authorization", "Bearer "+apiKey)
+	req.Header.Add("Content-Type", "application/json")
+
+	body, err := doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return streamLines(body, func(data string) (Event, bool) {
+		var streamResp StreamingResponse
+		if err := json.Unmarshal([]byte(data), &streamResp); err != nil {
+			return Event{}, false
+		}
+		event := Event{Usage: streamResp.Usage}
+		for _, choice := range streamResp.Choices {
+			event.Content += choice.Delta.Content
+		}
+		return event, true
+	}), nil
+}
+
+// anthropicMessage is the subset of Anthropic's Messages API request shape
+// this tool needs; unlike the OpenAI-style providers, the system prompt is a
+// top-level field rather than a message with role "system".
+type anthropicMessage struct {
+	Model     string    `json:"model"`
+	System    string    `json:"system,omitempty"`
+	Messages  []Message `json:"messages"`
+	MaxTokens int       `json:"max_tokens"`
+	Stream    bool      `json:"stream"`
+}
+
+// anthropicEvent models the fields used out of Anthropic's streaming events:
+// content_block_delta (text), message_start (input token count), and
+// message_delta (output token count, sent with the final event).
+type anthropicEvent struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"delta"`
+	Usage struct {
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Message struct {
+		Usage struct {
+			InputTokens int `json:"input_tokens"`
+		} `json:"usage"`
+	} `json:"message"`
+}
+
+// anthropicCompleter talks to the Anthropic Messages API.
+type anthropicCompleter struct{}
+
+func (c *anthropicCompleter) Stream(ctx context.Context, payload RequestPayload) (<-chan Event, error) {
+	apiKey := os.Getenv("ANTHROPIC_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("please set your ANTHROPIC_API_KEY environment variable")
+	}
+
+	req2 := anthropicMessage{
+		Model:     payload.Model,
+		MaxTokens: payload.MaxTokens,
+		Stream:    payload.Stream,
+	}
+	for _, m := range payload.Messages {
+		if m.Role == "system" {
+			req2.System = m.Content
+			continue
+		}
+		req2.Messages = append(req2.Messages, m)
+	}
+
+	jsonPayload, err := json.Marshal(req2)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewReader(jsonPayload))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Add("x-api-key", apiKey)
+	req.Header.Add("anthropic-version", "2023-06-01")
+	req.Header.Add("Content-Type", "application/json")
+
+	body, err := doRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var promptTokens int
+	return streamLines(body, func(data string) (Event, bool) {
+		var evt anthropicEvent
+		if err := json.Unmarshal([]byte(data), &evt); err != nil {
+			return Event{}, false
+		}
+		switch evt.Type {
+		case "message_start":
+			promptTokens = evt.Message.Usage.InputTokens
+			return Event{}, false
+		case "message_delta":
+			completionTokens := evt.Usage.OutputTokens
+			return Event{Usage: &render.Usage{
+				PromptTokens:     promptTokens,
+				CompletionTokens: completionTokens,
+				TotalTokens:      promptTokens + completionTokens,
+			}}, true
+		case "content_block_delta":
+			if evt.Delta.Type != "text_delta" {
+				return Event{}, false
+			}
+			return Event{Content: evt.Delta.Text}, true
+		default:
+			return Event{}, false
+		}
+	}), nil
+}
@@ -1,15 +1,13 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
-	"strings"
+
+	"github.com/lucas-Nicolas/perp_tool/render"
+	"github.com/lucas-Nicolas/perp_tool/session"
 )
 
 // Message represents a message in the conversation.
@@ -20,12 +18,18 @@ type Message struct {
 
 // RequestPayload is the structure sent to the Perplexity API.
 type RequestPayload struct {
-	Model       string    `json:"model"`
-	Messages    []Message `json:"messages"`
-	MaxTokens   int       `json:"max_tokens"`
-	Temperature float64   `json:"temperature"`
-	TopP        float64   `json:"top_p"`
-	Stream      bool      `json:"stream"`
+	Model         string         `json:"model"`
+	Messages      []Message      `json:"messages"`
+	MaxTokens     int            `json:"max_tokens"`
+	Temperature   float64        `json:"temperature"`
+	TopP          float64        `json:"top_p"`
+	Stream        bool           `json:"stream"`
+	StreamOptions *StreamOptions `json:"stream_options,omitempty"`
+}
+
+// StreamOptions controls what extra data a streaming response includes.
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // StreamingChoice represents one choice in the streaming response.
@@ -38,139 +42,154 @@ type StreamingChoice struct {
 type StreamingResponse struct {
 	Choices   []StreamingChoice `json:"choices"`
 	Citations []string          `json:"citations,omitempty"`
+	Usage     *render.Usage     `json:"usage,omitempty"`
 }
 
+const defaultSystemPrompt = "Be precise and concise."
+
 func main() {
+	// Dispatch to subcommands before touching the flag package, since each
+	// has its own flag set.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "session":
+			runSessionCommand(os.Args[2:])
+			return
+		case "serve":
+			runServeCommand(os.Args[2:])
+			return
+		case "explain":
+			runExplainCommand(os.Args[2:])
+			return
+		}
+	}
+
 	// Parse command-line flags.
 	model := flag.String("model", "sonar", "Model name to use (defaults to sonar)")
+	provider := flag.String("provider", "", "Completer to use: perplexity, openai, anthropic, or mistral (defaults to $DEFAULT_COMPLETER or perplexity)")
+	sessionName := flag.String("session", "", "Session to read from and append to (see `perp session`); defaults to the active session, if any")
+	systemPrompt := flag.String("system", "", "Override the system prompt for this query (or the session it belongs to)")
+	showUsage := flag.Bool("show-usage", false, "Print a token usage summary after the response")
+	showCost := flag.Bool("show-cost", false, "Print an estimated USD cost after the response (implies --show-usage)")
+	format := flag.String("format", "raw", "Output format: text, md, json, or raw (defaults to raw, the tool's original behavior)")
+	cite := flag.String("cite", "inline", "Citation style for text/md output: inline, footnote, or none (raw output is unaffected)")
 	flag.Parse()
 
 	// Ensure the query is provided.
 	args := flag.Args()
 	if len(args) < 1 {
-		fmt.Println("Usage: perp \"<query>\" --model <model name>")
+		fmt.Println("Usage: perp \"<query>\" --model <model name> --provider <provider name> --session <name> --system <prompt> --show-usage --show-cost --format text|md|json|raw --cite inline|footnote|none")
 		os.Exit(1)
 	}
 	query := args[0]
 
-	// Build the request payload.
-	payload := RequestPayload{
-		Model:       *model,
-		MaxTokens:   123,
-		Temperature: 0.2,
-		TopP:        0.9,
-		Stream:      true, // Enable streaming.
-		Messages: []Message{
-			{Role: "system", Content: "Be precise and concise."},
-			{Role: "user", Content: query},
-		},
+	name := *sessionName
+	if name == "" {
+		current, err := session.Current()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		name = current
 	}
 
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		fmt.Println("Error marshaling payload:", err)
-		os.Exit(1)
+	var sess *session.Session
+	if name != "" {
+		var err error
+		sess, err = session.Load(name)
+		if err != nil {
+			// A session named via --session that doesn't exist yet is
+			// created on first use; `perp session new` remains the way to
+			// set its system prompt up front.
+			sess = &session.Session{Name: name}
+		}
 	}
 
-	// Get the API token from the environment.
-	apiKey := os.Getenv("PERPLEXITY_API_KEY")
-	if apiKey == "" {
-		fmt.Println("Please set your PERPLEXITY_API_KEY environment variable")
-		os.Exit(1)
+	system := defaultSystemPrompt
+	switch {
+	case *systemPrompt != "":
+		system = *systemPrompt
+	case sess != nil && sess.System != "":
+		system = sess.System
 	}
 
-	// Create and send the HTTP request.
-	req, err := http.NewRequest("POST", "https://api.perplexity.ai/chat/completions", bytes.NewReader(jsonPayload))
-	if err != nil {
-		fmt.Println("Error creating request:", err)
-		os.Exit(1)
+	messages := []Message{{Role: "system", Content: system}}
+	if sess != nil {
+		for _, m := range sess.Messages {
+			messages = append(messages, Message{Role: m.Role, Content: m.Content})
+		}
 	}
-	req.Header.Add("Authorization", "Bearer "+apiKey)
-	req.Header.Add("Content-Type", "application/json")
+	messages = append(messages, Message{Role: "user", Content: query})
 
-	resp, err := http.DefaultClient.Do(req)
+	completer, err := NewCompleter(*provider)
 	if err != nil {
-		fmt.Println("Error sending request:", err)
+		fmt.Println(err)
 		os.Exit(1)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		fmt.Printf("Error: received status %d\n%s\n", resp.StatusCode, string(body))
+	// Build the request payload.
+	payload := RequestPayload{
+		Model:       *model,
+		MaxTokens:   123,
+		Temperature: 0.2,
+		TopP:        0.9,
+		Stream:      true, // Enable streaming.
+		Messages:    messages,
+	}
+	if *showUsage || *showCost {
+		payload.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+
+	events, err := completer.Stream(context.Background(), payload)
+	if err != nil {
+		fmt.Println(err)
 		os.Exit(1)
 	}
-	var citations []string
 
-	// Process the stream.
-	reader := bufio.NewReader(resp.Body)
-	for {
-		// Read one line at a time.
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			fmt.Println("Error reading stream:", err)
-			break
-		}
+	writer := render.NewWriter(os.Stdout, render.Format(*format), render.CiteStyle(*cite))
 
-		// Trim whitespace and skip if empty.
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
+	var usage *render.Usage
+	var reply string
+	for event := range events {
+		if len(event.Citations) > 0 {
+			writer.SetCitations(event.Citations)
 		}
+		if event.Usage != nil {
+			usage = event.Usage
+		}
+		reply += event.Content
+		writer.Delta(event.Content)
+	}
 
-		// Handle streaming format with "data:" prefix.
-		if strings.HasPrefix(line, "data:") {
-			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
-			// Check for the end of the stream.
-			if data == "[DONE]" {
-				break
-			}
-
-			// Parse the JSON chunk.
-			var streamResp StreamingResponse
-			if err := json.Unmarshal([]byte(data), &streamResp); err != nil {
-				fmt.Println("Error parsing JSON:", err)
-				continue
-			}
-			if len(streamResp.Choices) > 0 && len(citations) == 0 {
-				citations = streamResp.Citations
-			}
-
-			// Print only the text content.
-			for _, choice := range streamResp.Choices {
-				// Prefer the delta content (incremental update), but if empty, use full message content.
-				content := choice.Delta.Content
-				if content == "" {
-					content = choice.Message.Content
-				}
-				fmt.Print(content)
-			}
-		} else {
-			// In case the API returns a JSON object directly.
-			var streamResp StreamingResponse
-			if err := json.Unmarshal([]byte(line), &streamResp); err != nil {
-				continue
-			}
-			for _, choice := range streamResp.Choices {
-				content := choice.Delta.Content
-				if content == "" {
-					content = choice.Message.Content
-				}
-				fmt.Print(content)
+	var finishUsage *render.Usage
+	if usage != nil && (*showUsage || *showCost) {
+		finishUsage = usage
+	}
+	writer.Finish(finishUsage)
+
+	// The token/cost summary is its own line of output, not part of the
+	// citation rendering above, so it's skipped for --format json (which
+	// already embeds usage in its final object) to keep that output valid
+	// JSON.
+	if usage != nil && (*showUsage || *showCost) && render.Format(*format) != render.FormatJSON {
+		fmt.Printf("\ntokens: %d in / %d out / %d total\n", usage.PromptTokens, usage.CompletionTokens, usage.TotalTokens)
+		if *showCost {
+			if cost, ok := EstimateCost(*model, *usage); ok {
+				fmt.Printf("cost: $%.5f\n", cost)
+			} else {
+				fmt.Printf("cost: no pricing data for model %q\n", *model)
 			}
-
 		}
 	}
-	// Print citations as clickable links.
-	if len(citations) != 0 {
 
-		fmt.Println("\n\nCitations:")
-		for i, citation := range citations {
-			fmt.Printf("[%d] :%s\t", i+1, citation)
+	if sess != nil {
+		sess.System = system
+		sess.Append("user", query)
+		sess.Append("assistant", reply)
+		sess.Trim(session.DefaultTokenBudget)
+		if err := session.Save(sess); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
 		}
 	}
-
 }
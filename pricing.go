@@ -0,0 +1,37 @@
+package main
+
+import "github.com/lucas-Nicolas/perp_tool/render"
+
+// ModelPrice is the USD cost per million tokens for a model, split between
+// prompt and completion tokens since providers typically price them
+// differently.
+type ModelPrice struct {
+	PromptPerMillion     float64
+	CompletionPerMillion float64
+}
+
+// modelPrices is a small, manually maintained table used by --show-cost.
+// Prices are approximate list prices and meant only to give a rough sense
+// of spend per query, not an exact bill.
+var modelPrices = map[string]ModelPrice{
+	"sonar":                    {PromptPerMillion: 1, CompletionPerMillion: 1},
+	"sonar-pro":                {PromptPerMillion: 3, CompletionPerMillion: 15},
+	"gpt-4o":                   {PromptPerMillion: 2.5, CompletionPerMillion: 10},
+	"gpt-4o-mini":              {PromptPerMillion: 0.15, CompletionPerMillion: 0.6},
+	"claude-3-5-sonnet-latest": {PromptPerMillion: 3, CompletionPerMillion: 15},
+	"claude-3-5-haiku-latest":  {PromptPerMillion: 0.8, CompletionPerMillion: 4},
+	"mistral-large-latest":     {PromptPerMillion: 2, CompletionPerMillion: 6},
+	"mistral-small-latest":     {PromptPerMillion: 0.2, CompletionPerMillion: 0.6},
+}
+
+// EstimateCost returns the USD cost of usage for model, and false if model
+// isn't in the price table.
+func EstimateCost(model string, usage render.Usage) (float64, bool) {
+	price, ok := modelPrices[model]
+	if !ok {
+		return 0, false
+	}
+	cost := float64(usage.PromptTokens)/1e6*price.PromptPerMillion +
+		float64(usage.CompletionTokens)/1e6*price.CompletionPerMillion
+	return cost, true
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/lucas-Nicolas/perp_tool/render"
+)
+
+func TestEstimateCost(t *testing.T) {
+	usage := render.Usage{PromptTokens: 2_000_000, CompletionTokens: 500_000}
+
+	cost, ok := EstimateCost("sonar", usage)
+	if !ok {
+		t.Fatal("expected \"sonar\" to be in the price table")
+	}
+	want := 2.5 // 2M prompt tokens * $1/M + 0.5M completion tokens * $1/M
+	if math.Abs(cost-want) > 1e-9 {
+		t.Fatalf("EstimateCost(sonar, %+v) = %v, want %v", usage, cost, want)
+	}
+}
+
+func TestEstimateCostUnknownModel(t *testing.T) {
+	_, ok := EstimateCost("not-a-real-model", render.Usage{PromptTokens: 100})
+	if ok {
+		t.Fatal("expected an unknown model to report no pricing data")
+	}
+}
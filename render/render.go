@@ -0,0 +1,180 @@
+// Package render formats a streamed completion for the terminal or for
+// scripts, according to a requested output format and citation style.
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Format selects how a response is rendered.
+type Format string
+
+const (
+	FormatText     Format = "text"
+	FormatMarkdown Format = "md"
+	FormatJSON     Format = "json"
+	FormatRaw      Format = "raw"
+)
+
+// CiteStyle selects how citation markers like "[1]" are presented.
+// It has no effect on FormatRaw, which always preserves the tool's
+// original plain-text behavior.
+type CiteStyle string
+
+const (
+	CiteInline   CiteStyle = "inline"
+	CiteFootnote CiteStyle = "footnote"
+	CiteNone     CiteStyle = "none"
+)
+
+// Usage reports how many tokens a request consumed.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Writer renders a streamed completion to out as it arrives.
+type Writer struct {
+	out       io.Writer
+	format    Format
+	cite      CiteStyle
+	citations []string
+	full      strings.Builder
+}
+
+// NewWriter returns a Writer that renders to out using format and cite. An
+// unrecognized format falls back to FormatRaw.
+func NewWriter(out io.Writer, format Format, cite CiteStyle) *Writer {
+	switch format {
+	case FormatText, FormatMarkdown, FormatJSON, FormatRaw:
+	default:
+		format = FormatRaw
+	}
+	return &Writer{out: out, format: format, cite: cite}
+}
+
+// SetCitations records the response's citations. It is a no-op once
+// citations have already been set, since providers repeat them on every
+// chunk of a response.
+func (w *Writer) SetCitations(citations []string) {
+	if len(w.citations) == 0 {
+		w.citations = citations
+	}
+}
+
+// Delta renders one incremental piece of the completion. FormatJSON and
+// FormatRaw render each piece as it arrives; FormatText and FormatMarkdown
+// buffer and render the full response in Finish instead, since citation
+// linking and Markdown styling need context a single chunk may not have.
+func (w *Writer) Delta(content string) {
+	w.full.WriteString(content)
+	switch w.format {
+	case FormatJSON:
+		data, err := json.Marshal(struct {
+			Delta string `json:"delta"`
+		}{content})
+		if err == nil {
+			fmt.Fprintln(w.out, string(data))
+		}
+	case FormatMarkdown, FormatText:
+		// Rendered as a whole in Finish: a citation marker like "[12]" can
+		// straddle two deltas, so linking it requires the full text.
+	default: // FormatRaw
+		fmt.Fprint(w.out, content)
+	}
+}
+
+// Finish renders anything that can only be produced once the full response
+// and its usage are known: the markdown pass, the JSON summary object, or
+// the trailing citation list.
+func (w *Writer) Finish(usage *Usage) {
+	switch w.format {
+	case FormatJSON:
+		data, err := json.Marshal(struct {
+			Text      string   `json:"text"`
+			Citations []string `json:"citations,omitempty"`
+			Usage     *Usage   `json:"usage,omitempty"`
+		}{Text: w.full.String(), Citations: w.citations, Usage: usage})
+		if err == nil {
+			fmt.Fprintln(w.out, string(data))
+		}
+		return
+	case FormatMarkdown:
+		rendered := renderMarkdown(w.full.String())
+		if w.cite == CiteInline && len(w.citations) > 0 {
+			rendered = linkCitations(rendered, w.citations)
+		}
+		fmt.Fprint(w.out, rendered)
+	case FormatText:
+		text := w.full.String()
+		if w.cite == CiteInline && len(w.citations) > 0 {
+			text = linkCitations(text, w.citations)
+		}
+		fmt.Fprint(w.out, text)
+	}
+
+	if w.format == FormatRaw {
+		// Exactly the tool's original citation formatting, regardless of
+		// --cite: raw output never changes based on new flags.
+		if len(w.citations) != 0 {
+			fmt.Fprintln(w.out, "\n\nCitations:")
+			for i, citation := range w.citations {
+				fmt.Fprintf(w.out, "[%d] :%s\t", i+1, citation)
+			}
+		}
+		return
+	}
+
+	// CiteInline has already linked markers in place as content streamed (or,
+	// for Markdown, just above); only CiteFootnote needs a trailing list.
+	if len(w.citations) == 0 || w.cite != CiteFootnote {
+		return
+	}
+	fmt.Fprintln(w.out, "\n\nCitations:")
+	for i, citation := range w.citations {
+		fmt.Fprintf(w.out, "[%d] %s\n", i+1, hyperlink(citation, citation))
+	}
+}
+
+var citationRe = regexp.MustCompile(`\[(\d+)\]`)
+
+// linkCitations rewrites "[N]" markers in text into OSC-8 terminal
+// hyperlinks pointing at the corresponding citation URL.
+func linkCitations(text string, citations []string) string {
+	return citationRe.ReplaceAllStringFunc(text, func(match string) string {
+		n, err := strconv.Atoi(match[1 : len(match)-1])
+		if err != nil || n < 1 || n > len(citations) {
+			return match
+		}
+		return hyperlink(citations[n-1], match)
+	})
+}
+
+// hyperlink wraps text in an OSC-8 escape sequence linking to url, rendered
+// as a clickable link by supporting terminals and as plain text otherwise.
+func hyperlink(url, text string) string {
+	return "\x1b]8;;" + url + "\x1b\\" + text + "\x1b]8;;\x1b\\"
+}
+
+var (
+	boldRe   = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	codeRe   = regexp.MustCompile("`(.+?)`")
+	headerRe = regexp.MustCompile(`(?m)^#{1,6} (.+)$`)
+)
+
+// renderMarkdown applies a small set of common Markdown conventions
+// (headers, bold, inline code) as ANSI styling. It is not a full CommonMark
+// renderer; perp has no Markdown dependency, so this covers what model
+// output typically uses.
+func renderMarkdown(text string) string {
+	text = headerRe.ReplaceAllString(text, "\x1b[1;4m$1\x1b[0m")
+	text = boldRe.ReplaceAllString(text, "\x1b[1m$1\x1b[0m")
+	text = codeRe.ReplaceAllString(text, "\x1b[36m$1\x1b[0m")
+	return text
+}
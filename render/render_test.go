@@ -0,0 +1,196 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLinkCitationsRewritesKnownMarkers(t *testing.T) {
+	citations := []string{"http://a", "http://b"}
+	got := linkCitations("see [1] and [2] and [3]", citations)
+	want := "see " + hyperlink("http://a", "[1]") + " and " + hyperlink("http://b", "[2]") + " and [3]"
+	if got != want {
+		t.Fatalf("linkCitations() = %q, want %q", got, want)
+	}
+}
+
+func TestRenderMarkdownAppliesHeaderBoldAndCode(t *testing.T) {
+	got := renderMarkdown("# Title\n**bold** and `code`")
+	want := "\x1b[1;4mTitle\x1b[0m\n\x1b[1mbold\x1b[0m and \x1b[36mcode\x1b[0m"
+	if got != want {
+		t.Fatalf("renderMarkdown() = %q, want %q", got, want)
+	}
+}
+
+func TestWriterFormatRawIgnoresCiteStyle(t *testing.T) {
+	for _, cite := range []CiteStyle{CiteInline, CiteFootnote, CiteNone} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, FormatRaw, cite)
+		w.SetCitations([]string{"http://a", "http://b"})
+		w.Delta("Hello [1] and [2].")
+		w.Finish(nil)
+
+		want := "Hello [1] and [2].\n\nCitations:\n[1] :http://a\t[2] :http://b\t"
+		if got := buf.String(); got != want {
+			t.Fatalf("cite=%s: FormatRaw output = %q, want %q", cite, got, want)
+		}
+	}
+}
+
+func TestWriterFormatRawPrintsDeltasImmediately(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, FormatRaw, CiteNone)
+	w.Delta("Hello, ")
+	if got := buf.String(); got != "Hello, " {
+		t.Fatalf("FormatRaw did not print its first delta immediately, got %q", got)
+	}
+	w.Delta("world.")
+	w.Finish(nil)
+	if got := buf.String(); got != "Hello, world." {
+		t.Fatalf("FormatRaw output = %q, want %q", got, "Hello, world.")
+	}
+}
+
+func TestWriterFormatTextCiteNone(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, FormatText, CiteNone)
+	w.SetCitations([]string{"http://a"})
+	w.Delta("Hello [1].")
+	w.Finish(nil)
+
+	want := "Hello [1]."
+	if got := buf.String(); got != want {
+		t.Fatalf("FormatText/CiteNone output = %q, want %q", got, want)
+	}
+}
+
+func TestWriterFormatTextCiteInline(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, FormatText, CiteInline)
+	w.SetCitations([]string{"http://a"})
+	w.Delta("Hello [1].")
+	w.Finish(nil)
+
+	want := "Hello " + hyperlink("http://a", "[1]") + "."
+	if got := buf.String(); got != want {
+		t.Fatalf("FormatText/CiteInline output = %q, want %q", got, want)
+	}
+}
+
+// TestWriterFormatTextCiteInlineAcrossDeltas is a regression test: a
+// citation marker split across two Delta calls must still be linked, since
+// FormatText buffers the whole response and only links it in Finish.
+func TestWriterFormatTextCiteInlineAcrossDeltas(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, FormatText, CiteInline)
+	w.SetCitations([]string{"http://a"})
+	w.Delta("Hello [")
+	w.Delta("1].")
+	w.Finish(nil)
+
+	want := "Hello " + hyperlink("http://a", "[1]") + "."
+	if got := buf.String(); got != want {
+		t.Fatalf("FormatText/CiteInline output across deltas = %q, want %q", got, want)
+	}
+}
+
+func TestWriterFormatTextCiteFootnote(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, FormatText, CiteFootnote)
+	w.SetCitations([]string{"http://a", "http://b"})
+	w.Delta("Hello [1] and [2].")
+	w.Finish(nil)
+
+	want := "Hello [1] and [2].\n\nCitations:\n" +
+		"[1] " + hyperlink("http://a", "http://a") + "\n" +
+		"[2] " + hyperlink("http://b", "http://b") + "\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("FormatText/CiteFootnote output = %q, want %q", got, want)
+	}
+}
+
+func TestWriterFormatTextDoesNotPrintUntilFinish(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, FormatText, CiteNone)
+	w.Delta("Hello")
+	if got := buf.String(); got != "" {
+		t.Fatalf("FormatText printed before Finish: %q", got)
+	}
+	w.Finish(nil)
+	if got := buf.String(); got != "Hello" {
+		t.Fatalf("FormatText output = %q, want %q", got, "Hello")
+	}
+}
+
+func TestWriterFormatMarkdownRendersAndLinksAtFinish(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, FormatMarkdown, CiteInline)
+	w.SetCitations([]string{"http://a"})
+	w.Delta("# Title\n**bold** [1]")
+	w.Finish(nil)
+
+	want := "\x1b[1;4mTitle\x1b[0m\n\x1b[1mbold\x1b[0m " + hyperlink("http://a", "[1]")
+	if got := buf.String(); got != want {
+		t.Fatalf("FormatMarkdown output = %q, want %q", got, want)
+	}
+}
+
+func TestWriterFormatJSONEmitsDeltaThenFinalObject(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, FormatJSON, CiteNone)
+	w.SetCitations([]string{"http://a"})
+	w.Delta("Hello")
+	w.Delta(" world")
+	w.Finish(&Usage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d JSON lines, want 3 (two deltas + final object): %q", len(lines), buf.String())
+	}
+
+	var d1, d2 struct {
+		Delta string `json:"delta"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &d1); err != nil {
+		t.Fatalf("unmarshaling first delta: %v", err)
+	}
+	if d1.Delta != "Hello" {
+		t.Fatalf("first delta = %q, want %q", d1.Delta, "Hello")
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &d2); err != nil {
+		t.Fatalf("unmarshaling second delta: %v", err)
+	}
+	if d2.Delta != " world" {
+		t.Fatalf("second delta = %q, want %q", d2.Delta, " world")
+	}
+
+	var final struct {
+		Text      string   `json:"text"`
+		Citations []string `json:"citations"`
+		Usage     Usage    `json:"usage"`
+	}
+	if err := json.Unmarshal([]byte(lines[2]), &final); err != nil {
+		t.Fatalf("unmarshaling final object: %v", err)
+	}
+	if final.Text != "Hello world" {
+		t.Fatalf("final.Text = %q, want %q", final.Text, "Hello world")
+	}
+	if len(final.Citations) != 1 || final.Citations[0] != "http://a" {
+		t.Fatalf("final.Citations = %v, want [http://a]", final.Citations)
+	}
+	if final.Usage != (Usage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3}) {
+		t.Fatalf("final.Usage = %+v, want {1 2 3}", final.Usage)
+	}
+}
+
+func TestNewWriterFallsBackToRawForUnknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, Format("bogus"), CiteNone)
+	w.Delta("Hello")
+	w.Finish(nil)
+	if got := buf.String(); got != "Hello" {
+		t.Fatalf("unknown format output = %q, want %q (raw passthrough)", got, "Hello")
+	}
+}
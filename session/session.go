@@ -0,0 +1,235 @@
+// Package session stores named, multi-turn conversation histories on disk so
+// that a sequence of `perp` invocations can share context.
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultTokenBudget is the rough token ceiling used to trim a session's
+// history before it is sent back to a model. It is intentionally
+// conservative since the estimate in EstimateTokens is approximate.
+const DefaultTokenBudget = 4000
+
+// Message is one turn in a session history.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Session is a named conversation history persisted to disk.
+type Session struct {
+	Name     string    `json:"name"`
+	System   string    `json:"system,omitempty"`
+	Messages []Message `json:"messages"`
+}
+
+// Dir returns the directory sessions are stored in (~/.perp/sessions),
+// creating it if necessary.
+func Dir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("finding home directory: %w", err)
+	}
+	dir := filepath.Join(home, ".perp", "sessions")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("creating session directory: %w", err)
+	}
+	return dir, nil
+}
+
+func path(name string) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+// New creates and persists an empty session named name, failing if one
+// already exists.
+func New(name, system string) (*Session, error) {
+	p, err := path(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(p); err == nil {
+		return nil, fmt.Errorf("session %q already exists", name)
+	}
+	s := &Session{Name: name, System: system}
+	if err := Save(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load reads the named session from disk.
+func Load(name string) (*Session, error) {
+	p, err := path(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("session %q does not exist", name)
+		}
+		return nil, fmt.Errorf("reading session %q: %w", name, err)
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing session %q: %w", name, err)
+	}
+	return &s, nil
+}
+
+// Save writes s to disk, overwriting any existing file.
+func Save(s *Session) error {
+	p, err := path(s.Name)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling session %q: %w", s.Name, err)
+	}
+	if err := os.WriteFile(p, data, 0o644); err != nil {
+		return fmt.Errorf("writing session %q: %w", s.Name, err)
+	}
+	return nil
+}
+
+// Remove deletes the named session from disk. If it was the active session
+// (see SetCurrent), the active-session marker is cleared too, so a
+// subsequent query without --session doesn't resurrect it under the same
+// name.
+func Remove(name string) error {
+	p, err := path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("session %q does not exist", name)
+		}
+		return fmt.Errorf("removing session %q: %w", name, err)
+	}
+
+	current, err := Current()
+	if err != nil {
+		return err
+	}
+	if current == name {
+		if err := ClearCurrent(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the names of all persisted sessions, sorted by filename.
+func List() ([]string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading session directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	return names, nil
+}
+
+// currentPath is where the name of the active session (set by `perp session
+// use`) is stored.
+func currentPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("finding home directory: %w", err)
+	}
+	dir := filepath.Join(home, ".perp")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("creating .perp directory: %w", err)
+	}
+	return filepath.Join(dir, "current"), nil
+}
+
+// SetCurrent marks name as the active session used when --session is
+// omitted.
+func SetCurrent(name string) error {
+	p, err := currentPath()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, []byte(name), 0o644)
+}
+
+// ClearCurrent unsets the active session, if any.
+func ClearCurrent() error {
+	p, err := currentPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("clearing active session: %w", err)
+	}
+	return nil
+}
+
+// Current returns the active session name, or "" if none has been set.
+func Current() (string, error) {
+	p, err := currentPath()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("reading active session: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// EstimateTokens returns a rough token count for s, using the common
+// approximation of one token per four characters.
+func EstimateTokens(s string) int {
+	return len(s)/4 + 1
+}
+
+// Trim drops the oldest messages (the system prompt is tracked separately
+// and is never dropped) until the remaining history's estimated token count
+// fits within budget.
+func (s *Session) Trim(budget int) {
+	total := EstimateTokens(s.System)
+	keepFrom := 0
+	totals := make([]int, len(s.Messages))
+	for i, m := range s.Messages {
+		totals[i] = EstimateTokens(m.Content)
+	}
+	for i := len(s.Messages) - 1; i >= 0; i-- {
+		if total+totals[i] > budget {
+			keepFrom = i + 1
+			break
+		}
+		total += totals[i]
+	}
+	s.Messages = s.Messages[keepFrom:]
+}
+
+// Append adds a message to the session's history.
+func (s *Session) Append(role, content string) {
+	s.Messages = append(s.Messages, Message{Role: role, Content: content})
+}
@@ -0,0 +1,108 @@
+package session
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTrimDropsOldestMessagesFirst(t *testing.T) {
+	s := &Session{
+		System: "sys", // EstimateTokens("sys") == 1
+		Messages: []Message{
+			{Role: "user", Content: strings.Repeat("a", 40)},      // 11 tokens
+			{Role: "assistant", Content: strings.Repeat("b", 40)}, // 11 tokens
+			{Role: "user", Content: strings.Repeat("c", 40)},      // 11 tokens
+		},
+	}
+
+	s.Trim(12)
+
+	if len(s.Messages) != 1 {
+		t.Fatalf("got %d messages after trim, want 1: %+v", len(s.Messages), s.Messages)
+	}
+	if s.Messages[0].Content != strings.Repeat("c", 40) {
+		t.Fatalf("trim kept the wrong message: %+v", s.Messages[0])
+	}
+}
+
+func TestTrimKeepsEverythingWithinBudget(t *testing.T) {
+	s := &Session{
+		System: "sys",
+		Messages: []Message{
+			{Role: "user", Content: "hi"},
+			{Role: "assistant", Content: "hello"},
+		},
+	}
+	want := len(s.Messages)
+
+	s.Trim(DefaultTokenBudget)
+
+	if len(s.Messages) != want {
+		t.Fatalf("got %d messages after trim, want %d (nothing should be dropped)", len(s.Messages), want)
+	}
+}
+
+func TestTrimNeverDropsTheSystemPrompt(t *testing.T) {
+	s := &Session{
+		System:   "keep me",
+		Messages: []Message{{Role: "user", Content: strings.Repeat("a", 1000)}},
+	}
+
+	s.Trim(1) // budget too small even for the system prompt alone
+
+	if s.System != "keep me" {
+		t.Fatalf("System prompt was modified by Trim: %q", s.System)
+	}
+	if len(s.Messages) != 0 {
+		t.Fatalf("got %d messages after trim, want 0", len(s.Messages))
+	}
+}
+
+func TestRemoveActiveSessionClearsCurrent(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if _, err := New("work", ""); err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := SetCurrent("work"); err != nil {
+		t.Fatalf("SetCurrent: %v", err)
+	}
+
+	if err := Remove("work"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	current, err := Current()
+	if err != nil {
+		t.Fatalf("Current: %v", err)
+	}
+	if current != "" {
+		t.Fatalf("Current() = %q after removing the active session, want \"\"", current)
+	}
+}
+
+func TestRemoveInactiveSessionLeavesCurrentAlone(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	if _, err := New("work", ""); err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if _, err := New("other", ""); err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := SetCurrent("work"); err != nil {
+		t.Fatalf("SetCurrent: %v", err)
+	}
+
+	if err := Remove("other"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+
+	current, err := Current()
+	if err != nil {
+		t.Fatalf("Current: %v", err)
+	}
+	if current != "work" {
+		t.Fatalf("Current() = %q after removing an unrelated session, want \"work\"", current)
+	}
+}